@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// acceptCHHeader lists the Client Hints this service wants Chromium browsers
+// to start sending on subsequent requests, since the User-Agent string is
+// frozen and no longer reliable for OS/version detection on its own.
+const acceptCHHeader = "Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform, Sec-CH-UA-Platform-Version"
+
+// ClientHints holds the subset of HTTP Client Hints headers this service
+// understands. When Present, these are trusted over UA-string parsing.
+type ClientHints struct {
+	Present         bool
+	Mobile          bool
+	Platform        string
+	PlatformVersion string
+}
+
+// clientHintsFromRequest reads Sec-CH-UA-* headers off request. Present is
+// false when the browser didn't send Sec-CH-UA-Platform, the one hint every
+// other field depends on.
+func clientHintsFromRequest(request *http.Request) ClientHints {
+	platform := unquoteHint(request.Header.Get("Sec-CH-UA-Platform"))
+	if platform == "" {
+		return ClientHints{}
+	}
+
+	return ClientHints{
+		Present:         true,
+		Mobile:          request.Header.Get("Sec-CH-UA-Mobile") == "?1",
+		Platform:        platform,
+		PlatformVersion: unquoteHint(request.Header.Get("Sec-CH-UA-Platform-Version")),
+	}
+}
+
+func unquoteHint(value string) string {
+	return strings.Trim(value, `"`)
+}
+
+// applyClientHints overlays hints onto a UA-string-derived DeviceInfo.
+// Client Hints report platform and version directly, so when present they
+// replace the regex-derived values rather than merely supplementing them.
+func applyClientHints(info DeviceInfo, hints ClientHints) DeviceInfo {
+	if !hints.Present {
+		return info
+	}
+
+	switch hints.Platform {
+	case "Android":
+		info.Platform = PlatformAndroid
+		info.IsMobile = hints.Mobile
+		info.AndroidIsStrictMobile = hints.Mobile
+		info.OSVersion, _ = ParseVersion(hints.PlatformVersion)
+
+	case "iOS":
+		if hints.Mobile {
+			info.Platform = PlatformIPhone
+		} else {
+			info.Platform = PlatformIPad
+			info.IsTablet = true
+		}
+		info.IsMobile = true
+		info.OSVersion, _ = ParseVersion(hints.PlatformVersion)
+	}
+
+	return info
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// CONFIG_PATH is where Config is loaded from on startup. Override by
+// setting the REDIRECT_CONFIG environment variable.
+const CONFIG_PATH = "config.json"
+
+// Rule configures how requests to a single Path are handled: the minimum
+// supported OS versions, the store URLs to redirect to, the fallback page
+// for unsupported devices, and per-platform flags for platforms that have no
+// store of their own.
+type Rule struct {
+	Path string `json:"path"`
+
+	MinIOSVersion     Version `json:"min_ios_version"`
+	MinAndroidVersion Version `json:"min_android_version"`
+
+	AppleAppStoreURL   string `json:"apple_app_store_url"`
+	GooglePlayStoreURL string `json:"google_play_store_url"`
+
+	// FallbackPageTemplate is an html/template file rendered for the PAGE
+	// result. Defaults to defaultFallbackTemplate when empty.
+	FallbackPageTemplate string      `json:"fallback_page_template"`
+	CTAButtons           []CTAButton `json:"cta_buttons"`
+
+	// IOSRedirectScheme controls the scheme used for AppleAppStoreURL
+	// redirects: "https" (default) goes through Safari's App Store page,
+	// "itms-apps" opens the App Store app directly.
+	IOSRedirectScheme string `json:"ios_redirect_scheme"`
+
+	AndroidStrict bool `json:"android_strict"`
+
+	// IPad, WindowsPhone, Blackberry and Kindle never have a store to
+	// redirect to, so these platforms always get the PAGE result with a
+	// "... is not supported" reason; these flags do not change the result
+	// or the reason.
+	IPadSupported         bool `json:"ipad_supported"`
+	WindowsPhoneSupported bool `json:"windows_phone_supported"`
+	BlackberrySupported   bool `json:"blackberry_supported"`
+	KindleSupported       bool `json:"kindle_supported"`
+}
+
+// Config is the top-level app configuration, loaded once at startup.
+type Config struct {
+	Port     string `json:"port"`
+	Detector string `json:"detector"`
+	Routes   []Rule `json:"routes"`
+
+	// DebugAllowlist lists the client IPs allowed to pass ?debug=1. Debug
+	// info can reveal internal rule details, so it's opt-in per deployment
+	// rather than a global switch anyone can flip.
+	DebugAllowlist []string `json:"debug_allowlist"`
+
+	// TrustedProxies lists the IPs (the direct TCP peer, i.e. RemoteAddr)
+	// allowed to set X-Forwarded-For for access-control decisions like the
+	// debug allowlist. Without an entry here, X-Forwarded-For is treated as
+	// attacker-controlled and ignored for that purpose.
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// LoadConfig reads and parses the JSON config file at path.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// defaultConfig reproduces the single hard-coded route this service shipped
+// with before routes became configurable, so it still runs out of the box
+// without a config file.
+func defaultConfig() Config {
+	return Config{
+		Port:     PORT,
+		Detector: "mssola",
+		Routes: []Rule{
+			{
+				Path:               "/",
+				MinIOSVersion:      Version{Major: 8},
+				MinAndroidVersion:  Version{Major: 5},
+				AppleAppStoreURL:   APPLE_APP_STORE_REDIRECT_URL,
+				GooglePlayStoreURL: GOOGLE_PLAY_STORE_REDIRECT_URL,
+				AndroidStrict:      ANDROID_STRICT,
+			},
+		},
+	}
+}
+
+// loadConfigOrDefault loads CONFIG_PATH (or REDIRECT_CONFIG if set), falling
+// back to defaultConfig when no config file is present.
+func loadConfigOrDefault() Config {
+	path := CONFIG_PATH
+	if envPath := os.Getenv("REDIRECT_CONFIG"); envPath != "" {
+		path = envPath
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		log.Printf("no config at %s (%v), using built-in default route", path, err)
+		return defaultConfig()
+	}
+	return cfg
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mssola/user_agent"
+)
+
+// Platform identifies the broad device platform a request came from.
+type Platform string
+
+const (
+	PlatformIPhone       Platform = "iPhone"
+	PlatformIPad         Platform = "iPad"
+	PlatformIPod         Platform = "iPod"
+	PlatformAndroid      Platform = "Android"
+	PlatformWindowsPhone Platform = "WindowsPhone"
+	PlatformBlackberry   Platform = "Blackberry"
+	PlatformKindle       Platform = "Kindle"
+	PlatformOther        Platform = "Other"
+)
+
+// DeviceInfo is the structured result of parsing a User-Agent string into
+// the fields handlers actually need, independent of which detection
+// backend produced it.
+type DeviceInfo struct {
+	Platform       Platform
+	OSName         string
+	OSVersion      Version
+	DeviceName     string
+	IsTablet       bool
+	IsMobile       bool
+	IsBot          bool
+	Browser        string
+	BrowserVersion string
+
+	// AndroidIsStrictMobile reports whether the UA identifies itself as a
+	// mobile Android browser (Mobile Safari/Chrome, or Mozilla's "Mobile"
+	// OS token) rather than a desktop browser spoofing the OS string. Only
+	// meaningful when Platform == PlatformAndroid; a Rule decides whether
+	// to actually enforce it via AndroidStrict.
+	AndroidIsStrictMobile bool
+}
+
+// Detector turns a raw User-Agent string (plus any Client Hints sent
+// alongside it) into a DeviceInfo. Swapping the Detector implementation
+// lets us change UA parsing backends without touching handler code.
+type Detector interface {
+	Detect(ua string, hints ClientHints) DeviceInfo
+}
+
+// NewDetector selects a Detector implementation by name. Unknown names fall
+// back to "mssola", the original parsing library used by this service.
+func NewDetector(name string) Detector {
+	switch name {
+	case "mileusna":
+		return MileusnaDetector{}
+	default:
+		return MssolaDetector{}
+	}
+}
+
+// detector is the UA parsing backend in use. Defaults to MssolaDetector;
+// replace via NewDetector.
+var detector Detector = MssolaDetector{}
+
+// iosVersionPattern and androidVersionPattern capture up to three version
+// components so "16_4_1" and "13.0" both parse, unlike a plain float.
+var iosVersionPattern = regexp.MustCompile(`OS (\d+)(?:_(\d+))?(?:_(\d+))?\s`)
+var androidVersionPattern = regexp.MustCompile(`Android (\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+var androidMobilePattern = regexp.MustCompile(`Mobile Safari/{1}((\d+.){2,3})`)
+
+// botUAPattern catches well-known crawlers that mssola/user_agent's own
+// Bot() check misses, e.g. facebookexternalhit and Twitterbot.
+var botUAPattern = regexp.MustCompile(`(?i)bot|crawler|spider|facebookexternalhit|whatsapp|telegrambot|discordbot|slackbot|pinterest`)
+
+func looksLikeBot(ua string) bool {
+	return botUAPattern.MatchString(ua)
+}
+
+// namedBotPatterns maps well-known crawlers to a stable name for metrics
+// labels, checked in order so more specific patterns can be listed first.
+var namedBotPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"googlebot", regexp.MustCompile(`(?i)googlebot`)},
+	{"applebot", regexp.MustCompile(`(?i)applebot`)},
+	{"bingbot", regexp.MustCompile(`(?i)bingbot`)},
+	{"facebookexternalhit", regexp.MustCompile(`(?i)facebookexternalhit`)},
+	{"twitterbot", regexp.MustCompile(`(?i)twitterbot`)},
+	{"whatsapp", regexp.MustCompile(`(?i)whatsapp`)},
+	{"slackbot", regexp.MustCompile(`(?i)slackbot`)},
+	{"discordbot", regexp.MustCompile(`(?i)discordbot`)},
+	{"telegrambot", regexp.MustCompile(`(?i)telegrambot`)},
+}
+
+// botName returns a stable label for known crawlers, "other" for UAs that
+// only matched the generic bot pattern, or "" when ua isn't a bot at all.
+func botName(ua string) string {
+	for _, b := range namedBotPatterns {
+		if b.pattern.MatchString(ua) {
+			return b.name
+		}
+	}
+	if looksLikeBot(ua) {
+		return "other"
+	}
+	return ""
+}
+
+// MssolaDetector backs Detector with github.com/mssola/user_agent, the
+// parsing library this service has always used.
+type MssolaDetector struct{}
+
+func (MssolaDetector) Detect(ua string, hints ClientHints) DeviceInfo {
+	parsed := user_agent.New(ua)
+
+	info := DeviceInfo{
+		OSName:   getOS(parsed),
+		IsMobile: isMobile(parsed),
+		IsBot:    parsed.Bot() || looksLikeBot(ua),
+	}
+	info.Browser, info.BrowserVersion = parsed.Browser()
+
+	switch {
+	case parsed.Platform() == "iPhone":
+		info.Platform = PlatformIPhone
+		info.OSVersion = parseVersion(iosVersionPattern, info.OSName)
+	case parsed.Platform() == "iPad":
+		info.Platform = PlatformIPad
+		info.IsTablet = true
+		info.OSVersion = parseVersion(iosVersionPattern, info.OSName)
+	case parsed.Platform() == "iPod":
+		info.Platform = PlatformIPod
+		info.OSVersion = parseVersion(iosVersionPattern, info.OSName)
+	case parsed.Platform() == "Windows Phone":
+		info.Platform = PlatformWindowsPhone
+	case parsed.Platform() == "BlackBerry":
+		info.Platform = PlatformBlackberry
+	case strings.Contains(info.OSName, "Kindle") || strings.Contains(ua, "Kindle"):
+		info.Platform = PlatformKindle
+	case isAndroid(parsed):
+		info.Platform = PlatformAndroid
+		info.AndroidIsStrictMobile = androidMobilePattern.MatchString(ua) || parsed.OS() == "Mobile"
+		info.OSVersion = parseVersion(androidVersionPattern, info.OSName)
+	default:
+		info.Platform = PlatformOther
+	}
+
+	return applyClientHints(info, hints)
+}
+
+// parseVersion runs pattern against os and parses its first three capture
+// groups into a Version, treating missing groups as 0.
+func parseVersion(pattern *regexp.Regexp, os string) Version {
+	matches := pattern.FindStringSubmatch(os)
+	if matches == nil {
+		return Version{}
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(matches[1])
+	v.Minor, _ = strconv.Atoi(matches[2])
+	v.Patch, _ = strconv.Atoi(matches[3])
+	return v
+}
+
+func isAndroid(userAgent *user_agent.UserAgent) bool {
+	return strings.HasPrefix(getOS(userAgent), "Android")
+}
+
+func getOS(userAgent *user_agent.UserAgent) string {
+	// When on a Mozilla browser, the OS is "Mobile" and the (Android) device info is available the platform property.
+	if userAgent.OS() == "Mobile" {
+		return userAgent.Platform()
+	}
+	// Other devices/browsers
+	return userAgent.OS()
+}
+
+func isMobile(userAgent *user_agent.UserAgent) bool {
+	// When on a Mozilla browser, the Mobile() method returns false, but the OS is Mobile.
+	return userAgent.Mobile() || userAgent.OS() == "Mobile"
+}
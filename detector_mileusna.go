@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mileusna/useragent"
+)
+
+// MileusnaDetector backs Detector with github.com/mileusna/useragent, which
+// tracks modern iOS/Android UA strings more closely than mssola/user_agent
+// and also exposes a device name (e.g. "iPhone 14 Pro", "Huawei VNS-L21").
+type MileusnaDetector struct{}
+
+func (MileusnaDetector) Detect(ua string, hints ClientHints) DeviceInfo {
+	parsed := useragent.Parse(ua)
+
+	info := DeviceInfo{
+		OSName:         parsed.OS,
+		DeviceName:     parsed.Device,
+		IsTablet:       parsed.Tablet,
+		IsMobile:       parsed.Mobile,
+		IsBot:          parsed.Bot || looksLikeBot(ua),
+		Browser:        parsed.Name,
+		BrowserVersion: parsed.Version,
+	}
+
+	switch {
+	case parsed.OS == "iOS" && (parsed.Tablet || strings.Contains(parsed.Device, "iPad")):
+		info.Platform = PlatformIPad
+	case parsed.OS == "iOS" && strings.Contains(parsed.Device, "iPod"):
+		info.Platform = PlatformIPod
+	case parsed.OS == "iOS":
+		info.Platform = PlatformIPhone
+	case parsed.OS == "Windows Phone":
+		info.Platform = PlatformWindowsPhone
+	case parsed.OS == "BlackBerry":
+		info.Platform = PlatformBlackberry
+	case strings.Contains(parsed.Device, "Kindle"):
+		info.Platform = PlatformKindle
+	case parsed.OS == "Android":
+		info.Platform = PlatformAndroid
+		info.AndroidIsStrictMobile = parsed.Mobile
+	default:
+		info.Platform = PlatformOther
+	}
+
+	// parsed.OSVersion is already dotted (e.g. "16.4.1"). On garbage input
+	// ParseVersion returns a zero Version and an error; the error is ignored
+	// here, so OSVersion is left at 0.0.0.
+	info.OSVersion, _ = ParseVersion(parsed.OSVersion)
+	return applyClientHints(info, hints)
+}
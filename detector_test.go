@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func iphoneUA(major, minor int) string {
+	return fmt.Sprintf("Mozilla/5.0 (iPhone; CPU iPhone OS %d_%d like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%d.%d Mobile/15E148 Safari/604.1", major, minor, major, minor)
+}
+
+func androidUA(major, minor int) string {
+	return fmt.Sprintf("Mozilla/5.0 (Linux; Android %d.%d; Pixel 7 Build/TQ3A) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", major, minor)
+}
+
+func TestMssolaDetectorIOSVersions(t *testing.T) {
+	// iOS 8 through 17.
+	for major := 8; major <= 17; major++ {
+		ua := iphoneUA(major, 0)
+		info := MssolaDetector{}.Detect(ua, ClientHints{})
+
+		if info.Platform != PlatformIPhone {
+			t.Errorf("iOS %d: Platform = %v, want PlatformIPhone", major, info.Platform)
+		}
+		if info.OSVersion.Major != major {
+			t.Errorf("iOS %d: OSVersion.Major = %d, want %d (UA: %s)", major, info.OSVersion.Major, major, ua)
+		}
+		if !info.IsMobile {
+			t.Errorf("iOS %d: expected IsMobile", major)
+		}
+	}
+}
+
+func TestMssolaDetectorAndroidVersions(t *testing.T) {
+	// Android 5 through 14.
+	for major := 5; major <= 14; major++ {
+		ua := androidUA(major, 0)
+		info := MssolaDetector{}.Detect(ua, ClientHints{})
+
+		if info.Platform != PlatformAndroid {
+			t.Errorf("Android %d: Platform = %v, want PlatformAndroid", major, info.Platform)
+		}
+		if info.OSVersion.Major != major {
+			t.Errorf("Android %d: OSVersion.Major = %d, want %d (UA: %s)", major, info.OSVersion.Major, major, ua)
+		}
+		if !info.AndroidIsStrictMobile {
+			t.Errorf("Android %d: expected AndroidIsStrictMobile (UA identifies as Mobile Safari)", major)
+		}
+	}
+}
+
+func TestMssolaDetectorIPad(t *testing.T) {
+	ua := "Mozilla/5.0 (iPad; CPU OS 16_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.4 Mobile/15E148 Safari/604.1"
+	info := MssolaDetector{}.Detect(ua, ClientHints{})
+
+	if info.Platform != PlatformIPad {
+		t.Fatalf("Platform = %v, want PlatformIPad", info.Platform)
+	}
+	if !info.IsTablet {
+		t.Error("expected IsTablet")
+	}
+	if want := (Version{16, 4, 0}); info.OSVersion != want {
+		t.Errorf("OSVersion = %s, want %s", info.OSVersion, want)
+	}
+}
+
+func TestMssolaDetectorIPadOSReportsAsDesktopSafari(t *testing.T) {
+	// Since iPadOS 13, Safari's default UA for an iPad is indistinguishable
+	// from desktop Safari on a Mac; only client-side signals like
+	// navigator.maxTouchPoints can tell them apart, which this server-side
+	// detector has no access to. Document the resulting (known) behavior
+	// rather than pretend it parses correctly.
+	ua := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.4 Safari/604.1"
+	info := MssolaDetector{}.Detect(ua, ClientHints{})
+
+	if info.Platform != PlatformOther {
+		t.Errorf("Platform = %v, want PlatformOther (desktop-spoofed iPadOS can't be told apart server-side)", info.Platform)
+	}
+}
+
+func TestMssolaDetectorBots(t *testing.T) {
+	bots := []struct {
+		ua       string
+		wantName string
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "googlebot"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Safari/605.1.15 (Applebot/0.1)", "applebot"},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", "facebookexternalhit"},
+		{"Mozilla/5.0 (compatible; Twitterbot/1.0)", "twitterbot"},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", "bingbot"},
+	}
+
+	for _, b := range bots {
+		info := MssolaDetector{}.Detect(b.ua, ClientHints{})
+		if !info.IsBot {
+			t.Errorf("%q: expected IsBot", b.ua)
+		}
+		if got := botName(b.ua); got != b.wantName {
+			t.Errorf("botName(%q) = %q, want %q", b.ua, got, b.wantName)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestLogEntry is the structured JSON log line emitted once per request.
+type requestLogEntry struct {
+	Time       time.Time `json:"time"`
+	UA         string    `json:"ua"`
+	Platform   string    `json:"platform"`
+	OSVersion  string    `json:"os_version"`
+	Rule       string    `json:"rule"`
+	Result     string    `json:"result"`
+	ClientIP   string    `json:"client_ip"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+func logRequest(entry requestLogEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("failed to marshal request log entry: %v", err)
+		return
+	}
+	log.Println(string(data))
+}
+
+// clientIP returns the originating client IP for logging, honoring
+// X-Forwarded-For when the request came through a proxy or load balancer.
+// X-Forwarded-For is client-supplied and trivially spoofed, so this is only
+// safe to use for informational purposes (e.g. the request log); it must
+// not be used to make an access-control decision. Use trustedClientIP for
+// that.
+func clientIP(request *http.Request) string {
+	if xff := request.Header.Get("X-Forwarded-For"); xff != "" {
+		if first := strings.TrimSpace(strings.Split(xff, ",")[0]); first != "" {
+			return first
+		}
+	}
+	return directClientIP(request)
+}
+
+// trustedClientIP returns the client IP to use for access-control decisions
+// (e.g. the debug allowlist). X-Forwarded-For is only honored when the
+// connection's direct peer (request.RemoteAddr) is a configured trusted
+// proxy; otherwise it's attacker-controlled and ignored. When trusted, the
+// rightmost entry is used, since that's the hop the trusted proxy itself
+// appended and can't be forged by the client.
+func trustedClientIP(request *http.Request, trustedProxies map[string]bool) string {
+	direct := directClientIP(request)
+
+	if !trustedProxies[direct] {
+		return direct
+	}
+
+	xff := request.Header.Get("X-Forwarded-For")
+	hops := strings.Split(xff, ",")
+	if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+		return last
+	}
+	return direct
+}
+
+// directClientIP returns the host half of request.RemoteAddr: the IP of
+// whoever opened the TCP connection, ignoring any headers.
+func directClientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
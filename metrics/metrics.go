@@ -0,0 +1,57 @@
+// Package metrics exposes the Prometheus metrics for the redirect service.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redirect_requests_total",
+		Help: "Total redirect requests handled, by platform, OS version and result.",
+	}, []string{"platform", "os_version", "result"})
+
+	botTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redirect_bot_total",
+		Help: "Total requests identified as bots, by bot name.",
+	}, []string{"bot_name"})
+
+	unsupportedVersionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redirect_unsupported_version_total",
+		Help: "Total requests from a platform/version below the configured minimum.",
+	}, []string{"platform", "version"})
+
+	handlerDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "redirect_handler_duration_seconds",
+		Help:    "Time spent handling a redirect request.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// Handler returns the http.Handler to mount on /metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records one handled request's platform, OS version, result
+// and handler latency.
+func ObserveRequest(platform, osVersion, result string, duration time.Duration) {
+	requestsTotal.WithLabelValues(platform, osVersion, result).Inc()
+	handlerDuration.Observe(duration.Seconds())
+}
+
+// ObserveBot records one request identified as coming from botName.
+func ObserveBot(botName string) {
+	botTotal.WithLabelValues(botName).Inc()
+}
+
+// ObserveUnsupportedVersion records one request whose platform/version fell
+// below the configured minimum.
+func ObserveUnsupportedVersion(platform, version string) {
+	unsupportedVersionTotal.WithLabelValues(platform, version).Inc()
+}
@@ -4,11 +4,10 @@ import (
 	"net/http"
 	"log"
 	"fmt"
-	"github.com/mssola/user_agent"
 	"strconv"
-	"regexp"
-	"strings"
 	"time"
+
+	"github.com/thevrcinema/redirect/metrics"
 )
 
 // Result of device detection. Page if invalid or if not sure, otherwise Apple App store or Google Play store
@@ -19,15 +18,20 @@ const (
 	PLAYSTORE
 )
 
+func (r Result) String() string {
+	switch r {
+	case APPSTORE:
+		return "APPSTORE"
+	case PLAYSTORE:
+		return "PLAYSTORE"
+	default:
+		return "PAGE"
+	}
+}
+
 // Port to run server on, don't forget to prefix with ":"
 const PORT = ":8001"
 
-// Min IOS Version
-const MIN_IOS_VERSION = 8.0
-
-// Min Android Version
-const MIN_ANDROID_VERSION = 5.0
-
 // Check user agent string for presence of Mobile keyword
 const ANDROID_STRICT = true
 
@@ -37,19 +41,51 @@ const APPLE_APP_STORE_REDIRECT_URL = "https://itunes.apple.com/us/app/appname"
 // Google Play store URL to redirect to
 const GOOGLE_PLAY_STORE_REDIRECT_URL = "https://play.google.com/store/apps/details?id=xxx.xxx.xxx"
 
-// Default value for displaying debug info.
-// Visit root for normal version (http://localhost:8001)
-// Visit /debug for version with debug info (http://localhost:8001/debug)
-var DEBUG = false
+// routesByPath maps a configured Rule's Path to itself, built from Config at
+// startup. defaultRule is used for any path without its own Rule.
+var routesByPath map[string]Rule
+var defaultRule Rule
+
+// debugAllowlist holds the client IPs allowed to pass ?debug=1, built from
+// Config.DebugAllowlist at startup.
+var debugAllowlist map[string]bool
+
+// trustedProxies holds the direct peers allowed to set X-Forwarded-For for
+// access-control decisions, built from Config.TrustedProxies at startup.
+var trustedProxies map[string]bool
 
 //start app
 func main() {
-	// declare routes
-	http.HandleFunc("/", rootHandler)
-	http.HandleFunc("/debug", debugHandler)
+	cfg := loadConfigOrDefault()
+
+	detector = NewDetector(cfg.Detector)
+
+	routesByPath = make(map[string]Rule, len(cfg.Routes))
+	for _, rule := range cfg.Routes {
+		routesByPath[rule.Path] = rule
+		http.HandleFunc(rule.Path, rootHandler)
+	}
+	defaultRule = routesByPath["/"]
+
+	debugAllowlist = make(map[string]bool, len(cfg.DebugAllowlist))
+	for _, ip := range cfg.DebugAllowlist {
+		debugAllowlist[ip] = true
+	}
+
+	trustedProxies = make(map[string]bool, len(cfg.TrustedProxies))
+	for _, ip := range cfg.TrustedProxies {
+		trustedProxies[ip] = true
+	}
+
+	http.Handle("/metrics", metrics.Handler())
+
+	port := cfg.Port
+	if port == "" {
+		port = PORT
+	}
 
 	// start server
-	err := http.ListenAndServe(PORT, nil)
+	err := http.ListenAndServe(port, nil)
 
 	// show errors if any
 	if err != nil {
@@ -58,173 +94,160 @@ func main() {
 	}
 }
 
-func rootHandler(writer http.ResponseWriter, request *http.Request){
-	handler(writer, request)
+// ruleForPath looks up the Rule registered for path, falling back to the
+// Rule registered for "/" when path has none of its own.
+func ruleForPath(path string) Rule {
+	if rule, ok := routesByPath[path]; ok {
+		return rule
+	}
+	return defaultRule
 }
-func debugHandler(writer http.ResponseWriter, request *http.Request){
-	DEBUG = true
-	handler(writer, request)
+
+func rootHandler(writer http.ResponseWriter, request *http.Request){
+	handler(writer, request, ruleForPath(request.URL.Path))
 }
 
-func handler(writer http.ResponseWriter, request *http.Request)  {
-	// start timer
+func handler(writer http.ResponseWriter, request *http.Request, rule Rule)  {
 	start := time.Now()
 
-	// Get user agent info
-	ua := getUserAgent(request)
+	// Ask Chromium browsers to start sending Client Hints on future requests.
+	writer.Header().Set("Accept-CH", acceptCHHeader)
 
-	// default result
-	result := PAGE
+	// Get structured device info, trusting Client Hints over the UA string
+	// when the browser sent them.
+	hints := clientHintsFromRequest(request)
+	var info DeviceInfo = detector.Detect(request.UserAgent(), hints)
 
+	// default result
+	var result Result = PAGE
+	var reason string
+	var unsupportedVersion bool
+
+	defer func() {
+		duration := time.Since(start)
+		metrics.ObserveRequest(string(info.Platform), info.OSVersion.String(), result.String(), duration)
+		if name := botName(request.UserAgent()); name != "" {
+			metrics.ObserveBot(name)
+		}
+		if unsupportedVersion {
+			metrics.ObserveUnsupportedVersion(string(info.Platform), info.OSVersion.String())
+		}
+		logRequest(requestLogEntry{
+			Time:       start,
+			UA:         request.UserAgent(),
+			Platform:   string(info.Platform),
+			OSVersion:  info.OSVersion.String(),
+			Rule:       rule.Path,
+			Result:     result.String(),
+			ClientIP:   clientIP(request),
+			DurationMS: float64(duration.Microseconds()) / 1000,
+		})
+	}()
+
+	// debug info is opt-in per request (?debug=1) and gated on an IP
+	// allowlist, since it can reveal internal rule details and isn't safe
+	// to leave on for every visitor. The allowlist check uses
+	// trustedClientIP, not clientIP, since clientIP honors a client-supplied
+	// header that would otherwise let anyone spoof their way past it.
+	debug := request.URL.Query().Get("debug") == "1" && debugAllowlist[trustedClientIP(request, trustedProxies)]
+
+	if info.IsBot {
+		// Crawlers never get redirected to a store; they get the landing
+		// page with full Open Graph / app-links metadata so link previews
+		// and indexing work.
+		result = PAGE
+		reason = "Bot detected; serving landing page for crawlers"
+	} else if info.IsMobile {
+
+		switch info.Platform {
+		case PlatformIPhone:
+			if info.OSVersion.GTE(rule.MinIOSVersion) {
+				result = APPSTORE
+			} else {
+				reason = fmt.Sprintf("IOS version not supported. Needs to be at least %s. Your version is: %s", rule.MinIOSVersion, info.OSVersion)
+				unsupportedVersion = true
+			}
 
-	if DEBUG {
-		//print user agent info
-		showDebug(writer, ua)
-	}
+		case PlatformIPad:
+			if rule.IPadSupported {
+				result = PAGE
+			}
+			reason = "iPad is not supported"
 
-	//only execute if user is on a mobile device
-	if isMobile(ua) == true {
+		case PlatformWindowsPhone:
+			if rule.WindowsPhoneSupported {
+				result = PAGE
+			}
+			reason = "Windows Phone is not supported"
 
-		// Check iPhone
-		if ua.Platform() == "iPhone" {
-			version := getIphoneVersion(ua)
-			if version >= MIN_IOS_VERSION {
-				result = APPSTORE
-				if DEBUG { fmt.Fprintf(writer, "Result: IOS version is supported. Minimum version: %f. Your version: %2f\n", MIN_IOS_VERSION, version) }
-			} else {
-				if DEBUG { fmt.Fprintf(writer, "Result: IOS version not supported. Needs to be at least %f. Your version is: %2f\n", MIN_IOS_VERSION, version) }
+		case PlatformBlackberry:
+			if rule.BlackberrySupported {
+				result = PAGE
 			}
-		}
+			reason = "BlackBerry is not supported"
 
-		// Check iPad
-		if ua.Platform() == "iPad" {
-			fmt.Fprint(writer, "Result: iPad is not supported\n")
-		}
+		case PlatformKindle:
+			if rule.KindleSupported {
+				result = PAGE
+			}
+			reason = "Kindle is not supported"
 
-		// Check Android
-		if isAndroid(ua) {
-			version := getMobileAndroidVersion(ua)
-			if version >= MIN_ANDROID_VERSION {
+		case PlatformAndroid:
+			versionSupported := info.OSVersion.GTE(rule.MinAndroidVersion)
+			androidSupported := versionSupported
+			if rule.AndroidStrict && !info.AndroidIsStrictMobile {
+				androidSupported = false
+			}
+			if androidSupported {
 				result = PLAYSTORE
-				if DEBUG { fmt.Fprintf(writer, "Result: Android version is supported. Minimum version: %f. Your version: %2f\n", MIN_ANDROID_VERSION, version)}
 			} else {
-				if DEBUG { fmt.Fprintf(writer, "Result: Android version or device not supported. Needs to be a mobile device with at least version %f. Your version is: %2f\n", MIN_IOS_VERSION, version)}
+				reason = fmt.Sprintf("Android version or device not supported. Needs to be a mobile device with at least version %s. Your version is: %s", rule.MinAndroidVersion, info.OSVersion)
+				unsupportedVersion = !versionSupported
 			}
 		}
 	}
 
-	if DEBUG { fmt.Fprint(writer, "----------------- EOF DEBUG --------------\n\n") }
+	if debug {
+		showDebug(writer, info)
+		fmt.Fprintf(writer, "----------------- EOF DEBUG --------------\n\n")
+		fmt.Fprintf(writer, "Result: %s\nReason: %s\n", result, reason)
+		return
+	}
+
+	// Responses vary per User-Agent, so they must not be cached across devices.
+	writer.Header().Set("Vary", "User-Agent")
+	writer.Header().Set("Cache-Control", "private, no-cache")
 
-	// Work with result
 	switch (result){
 		// Show custom web page
 		case PAGE:
-		fmt.Fprint(writer, "Display custom page")
+		renderFallbackPage(writer, rule, info, reason)
 
 		// Redirect to app store
 		case APPSTORE:
-		fmt.Fprintf(writer, "Redirect to Apple App store:  %s\n", APPLE_APP_STORE_REDIRECT_URL)
+		target := withScheme(withCampaignParams(rule.AppleAppStoreURL, request.URL.Query()), rule.IOSRedirectScheme)
+		http.Redirect(writer, request, target, http.StatusFound)
 
 		// Redirect to play store
 		case PLAYSTORE:
-		fmt.Fprintf(writer, "Redirect to Google Play store:  %s\n", GOOGLE_PLAY_STORE_REDIRECT_URL)
+		target := withCampaignParams(rule.GooglePlayStoreURL, request.URL.Query())
+		http.Redirect(writer, request, target, http.StatusFound)
 	}
-
-	// Show duration
-	fmt.Fprintf(writer, "Duration:  %v\n", time.Since(start))
 }
 
 
-// Debug info about user agent
-func showDebug(writer http.ResponseWriter, ua *user_agent.UserAgent){
+// Debug info about the detected device
+func showDebug(writer http.ResponseWriter, info DeviceInfo){
 	fmt.Fprint(writer, "----------------- DEBUG INFO ---------------\n\n")
-	fmt.Fprintf(writer, "Full UA?: %s\n", ua.UA())
-	fmt.Fprintf(writer, "Is mobile?: %s\n", strconv.FormatBool(ua.Mobile()))
-	fmt.Fprintf(writer, "Is bot?: %s\n", strconv.FormatBool(ua.Bot()))
-
-	fmt.Fprintf(writer, "Platform: %s\n", ua.Platform())
-	fmt.Fprintf(writer, "OS: %s\n", ua.OS())
-
-	name, version := ua.Engine()
-	fmt.Fprintf(writer, "Engine name: %s\n", name)
-	fmt.Fprintf(writer, "Engine version: %s\n", version)
-
-	name, version = ua.Browser()
-	fmt.Fprintf(writer, "Browser name: %s\n", name)
-	fmt.Fprintf(writer, "Browser version: %s\n", version)
-}
-
-
-// Make user agent object from http request
-func getUserAgent(request *http.Request) *user_agent.UserAgent{
-	return user_agent.New(request.UserAgent());
-}
-
-
-func getIphoneVersion(userAgent *user_agent.UserAgent) float64{
-	pattern := "OS ((\\d+_?){2,3})\\s"
-	return getDeviceVersion(pattern, true, userAgent)
-}
-
-func getAndroidVersion(userAgent *user_agent.UserAgent) float64{
-	pattern := "Android (\\d+.\\d+)"
-	return getDeviceVersion(pattern, false, userAgent)
-}
-
-func getDeviceVersion(pattern string, replace bool, userAgent *user_agent.UserAgent) float64{
-	reg, _ := regexp.Compile(pattern)
-	matches := reg.FindAllStringSubmatch(getOS(userAgent), 1)
+	fmt.Fprintf(writer, "Is mobile?: %s\n", strconv.FormatBool(info.IsMobile))
+	fmt.Fprintf(writer, "Is bot?: %s\n", strconv.FormatBool(info.IsBot))
 
-	// Check if OS matches pattern and has at least 1 match
-	if reg.MatchString(getOS(userAgent)) == true && len(matches) > 0{
-		// get version number from matches
-		version_number := matches[0][1]
-
-		//iphone: replace _ for .
-		if replace {
-			version_number = strings.Replace(matches[0][1], "_", ".",-1)
-		}
-		// Convert to float
-		f,_ := strconv.ParseFloat(string(version_number), 64)
-		return f
-	}
-	return 0.0
-}
-
-func isAndroid(userAgent *user_agent.UserAgent) bool{
-	return strings.HasPrefix(getOS(userAgent), "Android")
-}
-
-func getMobileAndroidVersion(userAgent *user_agent.UserAgent) float64{
-
-	// If ANDROID_STRICT is true  check if Chromium or Mozilla browser is a mobile browser.
-	if(ANDROID_STRICT) {
-
-		// The pattern for a mobile browser
-		pattern := "Mobile Safari/{1}((\\d+.){2,3})"
-		reg, _ := regexp.Compile(pattern)
-
-		// If it is no valid mobile browser
-		if !reg.MatchString(userAgent.UA()) && userAgent.OS() != "Mobile"{
-			return 0.0
-		}
-	}
-
-	// return version number. If invalid it return 0.0
-	version := getAndroidVersion(userAgent)
-	return version
-}
-
-func getOS(userAgent *user_agent.UserAgent) string{
-	// When on a Mozilla browser, the OS is "Mobile" and the (Android) device info is available the platform property.
-	if(userAgent.OS() == "Mobile"){
-		return  userAgent.Platform()
-	}
-	// Other devices/browsers
-	return userAgent.OS()
-}
+	fmt.Fprintf(writer, "Platform: %s\n", info.Platform)
+	fmt.Fprintf(writer, "OS: %s\n", info.OSName)
+	fmt.Fprintf(writer, "OS version: %s\n", info.OSVersion)
+	fmt.Fprintf(writer, "Device name: %s\n", info.DeviceName)
+	fmt.Fprintf(writer, "Is tablet?: %s\n", strconv.FormatBool(info.IsTablet))
 
-func isMobile(userAgent *user_agent.UserAgent) bool{
-	// When on a Mozilla browser, the Mobile() method returns false, but the OS is Mobile.
-	return userAgent.Mobile() || userAgent.OS() == "Mobile"
+	fmt.Fprintf(writer, "Browser name: %s\n", info.Browser)
+	fmt.Fprintf(writer, "Browser version: %s\n", info.BrowserVersion)
 }
\ No newline at end of file
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// CTAButton is one call-to-action link rendered on the fallback page, e.g.
+// "Open in Safari" or "Learn more".
+type CTAButton struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// PageData is the set of variables available to a fallback-page template.
+type PageData struct {
+	Platform  Platform
+	OSName    string
+	OSVersion string
+	Reason    string
+	IsBot     bool
+
+	AppleAppStoreURL   string
+	GooglePlayStoreURL string
+	CTAButtons         []CTAButton
+}
+
+// defaultFallbackTemplate is used when a Rule doesn't name its own.
+const defaultFallbackTemplate = "templates/fallback.html"
+
+var (
+	templateCacheMu sync.RWMutex
+	templateCache   = map[string]*template.Template{}
+)
+
+// fallbackTemplate parses (and caches) the html/template file configured on
+// rule, falling back to defaultFallbackTemplate when none is set. Requests
+// are served on their own goroutine, so the cache is guarded by a mutex to
+// avoid concurrent map writes on two first-hits racing each other.
+func fallbackTemplate(rule Rule) (*template.Template, error) {
+	name := rule.FallbackPageTemplate
+	if name == "" {
+		name = defaultFallbackTemplate
+	}
+
+	templateCacheMu.RLock()
+	tmpl, ok := templateCache[name]
+	templateCacheMu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.ParseFiles(name)
+	if err != nil {
+		return nil, err
+	}
+
+	templateCacheMu.Lock()
+	templateCache[name] = tmpl
+	templateCacheMu.Unlock()
+	return tmpl, nil
+}
+
+// renderFallbackPage renders rule's fallback template with info and reason
+// describing why the visitor landed on PAGE instead of a store redirect.
+func renderFallbackPage(writer http.ResponseWriter, rule Rule, info DeviceInfo, reason string) {
+	tmpl, err := fallbackTemplate(rule)
+	if err != nil {
+		log.Printf("fallback template error: %v", err)
+		http.Error(writer, "Display custom page", http.StatusOK)
+		return
+	}
+
+	data := PageData{
+		Platform:           info.Platform,
+		OSName:             info.OSName,
+		OSVersion:          info.OSVersion.String(),
+		Reason:             reason,
+		IsBot:              info.IsBot,
+		AppleAppStoreURL:   rule.AppleAppStoreURL,
+		GooglePlayStoreURL: rule.GooglePlayStoreURL,
+		CTAButtons:         rule.CTAButtons,
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(writer, data); err != nil {
+		log.Printf("fallback template execute error: %v", err)
+	}
+}
+
+// withCampaignParams copies query string parameters (e.g. "?ref=promo1")
+// from the incoming request onto storeURL, so store listings can attribute
+// installs back to the referring campaign (deferred deep linking).
+func withCampaignParams(storeURL string, query url.Values) string {
+	if len(query) == 0 {
+		return storeURL
+	}
+
+	parsed, err := url.Parse(storeURL)
+	if err != nil {
+		return storeURL
+	}
+
+	dest := parsed.Query()
+	for key, values := range query {
+		for _, v := range values {
+			dest.Add(key, v)
+		}
+	}
+	parsed.RawQuery = dest.Encode()
+	return parsed.String()
+}
+
+// withScheme rewrites storeURL to use the itms-apps:// scheme instead of
+// https://, which skips the Safari redirect page and opens the App Store
+// app directly. A no-op unless scheme == "itms-apps".
+func withScheme(storeURL string, scheme string) string {
+	if scheme != "itms-apps" {
+		return storeURL
+	}
+
+	parsed, err := url.Parse(storeURL)
+	if err != nil {
+		return storeURL
+	}
+	parsed.Scheme = "itms-apps"
+	return parsed.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a major.minor.patch OS version. Parsing into three ints
+// (rather than a float64) is what lets "16.4.1" and "13_0" compare
+// correctly instead of silently failing strconv.ParseFloat.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 as v is less than, equal to, or greater than
+// other, comparing Major, then Minor, then Patch.
+func (v Version) Compare(other Version) int {
+	if v.Major != other.Major {
+		return compareInt(v.Major, other.Major)
+	}
+	if v.Minor != other.Minor {
+		return compareInt(v.Minor, other.Minor)
+	}
+	return compareInt(v.Patch, other.Patch)
+}
+
+// GTE reports whether v is greater than or equal to other.
+func (v Version) GTE(other Version) bool {
+	return v.Compare(other) >= 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ParseVersion parses a dotted or underscored version string ("16.4.1",
+// "16_4_1", "13.0") into a Version. Missing components default to 0, so
+// "13" and "13.0.0" parse the same.
+func ParseVersion(s string) (Version, error) {
+	s = strings.ReplaceAll(s, "_", ".")
+	if s == "" {
+		return Version{}, nil
+	}
+
+	parts := strings.SplitN(s, ".", 3)
+	var v Version
+	var err error
+
+	if v.Major, err = strconv.Atoi(parts[0]); err != nil {
+		return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+	}
+	if len(parts) > 1 {
+		if v.Minor, err = strconv.Atoi(parts[1]); err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+	}
+	if len(parts) > 2 {
+		if v.Patch, err = strconv.Atoi(parts[2]); err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+	}
+	return v, nil
+}
+
+// UnmarshalJSON lets a Version field in config be written as a plain
+// dotted string, e.g. "min_ios_version": "13.0".
+func (v *Version) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseVersion(s)
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+func (v Version) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Version
+	}{
+		{"16.4.1", Version{16, 4, 1}},
+		{"16_4_1", Version{16, 4, 1}},
+		{"13.0", Version{13, 0, 0}},
+		{"13", Version{13, 0, 0}},
+		{"", Version{0, 0, 0}},
+	}
+
+	for _, c := range cases {
+		got, err := ParseVersion(c.in)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) returned error: %v", c.in, err)
+		}
+		if got != c.want {
+			t.Errorf("ParseVersion(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	if _, err := ParseVersion("sixteen"); err == nil {
+		t.Fatal("expected an error parsing a non-numeric version")
+	}
+}
+
+func TestVersionGTE(t *testing.T) {
+	cases := []struct {
+		v, min Version
+		want   bool
+	}{
+		{Version{16, 4, 1}, Version{8, 0, 0}, true},
+		{Version{8, 0, 0}, Version{8, 0, 0}, true},
+		{Version{7, 9, 9}, Version{8, 0, 0}, false},
+		{Version{8, 0, 0}, Version{8, 0, 1}, false},
+		{Version{8, 1, 0}, Version{8, 0, 9}, true},
+	}
+
+	for _, c := range cases {
+		if got := c.v.GTE(c.min); got != c.want {
+			t.Errorf("%s.GTE(%s) = %v, want %v", c.v, c.min, got, c.want)
+		}
+	}
+}